@@ -0,0 +1,109 @@
+// Command conf-readonly-codemod rewrites call sites of the form
+// conf.Get().Basic.Foo / conf.Get().Core.Foo (field access against the old
+// *conf.SiteConfiguration struct) into conf.Get().Basic.Foo() /
+// conf.Get().Core.Foo() (method calls against the new
+// ReadOnlyBasic/ReadOnlyCore interfaces), across every non-test .go file
+// under the given root (files ending in _test.go are skipped).
+//
+// Usage:
+//
+//	go run ./dev/conf-readonly-codemod -root .
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// fields lists the named accessors that moved from struct fields to
+// interface getters; keep this in sync with pkg/conf/readonly.go. Anything
+// not in this list but still reachable through the old struct field access
+// pattern is left untouched by this codemod -- such call sites should move
+// to ReadOnlyBasic.Field/ReadOnlyCore.Field by hand, since there's no longer
+// a same-named method to rewrite them to.
+var fields = map[string]bool{
+	"AuthProviders": true,
+	"ExternalURL":   true,
+	"LicenseKey":    true,
+	"UpdateChannel": true,
+}
+
+func main() {
+	root := flag.String("root", ".", "root directory to walk for .go files")
+	dryRun := flag.Bool("dry-run", false, "print files that would change, without writing them")
+	flag.Parse()
+
+	if err := filepath.Walk(*root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return nil
+		}
+		return rewriteFile(path, *dryRun)
+	}); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func rewriteFile(path string, dryRun bool) error {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	changed := false
+	astutil.Apply(file, nil, func(c *astutil.Cursor) bool {
+		sel, ok := c.Node().(*ast.SelectorExpr)
+		if !ok || !matchesFieldAccess(sel) {
+			return true
+		}
+		// Leave it alone if it's already being called, e.g. `.Foo()` -- a
+		// SelectorExpr is a callee exactly when it's the Fun of the
+		// CallExpr that is its own parent.
+		if call, ok := c.Parent().(*ast.CallExpr); ok && call.Fun == sel {
+			return true
+		}
+		c.Replace(&ast.CallExpr{Fun: sel})
+		changed = true
+		return true
+	})
+	if !changed {
+		return nil
+	}
+
+	if dryRun {
+		fmt.Println(path)
+		return nil
+	}
+
+	var buf strings.Builder
+	if err := format.Node(&buf, fset, file); err != nil {
+		return fmt.Errorf("formatting %s: %w", path, err)
+	}
+	return ioutil.WriteFile(path, []byte(buf.String()), 0644)
+}
+
+// matchesFieldAccess reports whether sel is of the form
+// `<expr>.Basic.Field` / `<expr>.Core.Field` for a Field in the fields map,
+// which is the only shape this codemod rewrites -- this avoids touching
+// unrelated identifiers that happen to share a field name.
+func matchesFieldAccess(sel *ast.SelectorExpr) bool {
+	if !fields[sel.Sel.Name] {
+		return false
+	}
+	inner, ok := sel.X.(*ast.SelectorExpr)
+	return ok && (inner.Sel.Name == "Basic" || inner.Sel.Name == "Core")
+}
@@ -0,0 +1,167 @@
+package conf
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sourcegraph/sourcegraph/pkg/conf/loader"
+	"github.com/sourcegraph/sourcegraph/schema"
+)
+
+// StagedWatcher is given a chance to reject a candidate configuration before
+// it is committed. Returning an error rejects the candidate: it is never
+// written to basicStore or coreStore, so the previous configuration stays in
+// effect in both, and the error is surfaced back to whoever submitted the
+// edit. This prevents the old
+// failure mode where a bad config was persisted and every subsystem
+// discovered the problem independently, after the fact.
+type StagedWatcher func(candidate *SiteConfiguration) error
+
+// StagedWatcherTimeout bounds how long ApplyCandidate waits for all
+// StagedWatchers to accept or reject a candidate before giving up and
+// rejecting it itself.
+var StagedWatcherTimeout = 10 * time.Second
+
+// WatchStaged registers f to be called with every candidate configuration
+// submitted via ApplyCandidate, before it is durably committed. See
+// StagedWatcher for the rejection contract.
+//
+// WatchStaged is a wrapper around client.WatchStaged.
+func WatchStaged(f StagedWatcher) {
+	defaultClient.WatchStaged(f)
+}
+
+// WatchStaged registers f to be called with every candidate configuration.
+// See the package-level WatchStaged documentation for details.
+func (c *client) WatchStaged(f StagedWatcher) {
+	c.stagedWatchersMu.Lock()
+	defer c.stagedWatchersMu.Unlock()
+	c.stagedWatchers = append(c.stagedWatchers, f)
+}
+
+// ApplyCandidate is confserver's entry point for a two-phase config apply:
+// parse and run registered Validators and StagedWatchers over the candidate
+// entirely out-of-band of basicStore/coreStore, and only commit it to the
+// stores (where Get() and every concurrent reader will observe it) once
+// every validator and staged watcher has accepted it. Unlike a naive
+// "commit, then roll back on rejection" approach, a rejected candidate is
+// never visible to a reader in the first place.
+//
+// ApplyCandidate is a wrapper around client.ApplyCandidate.
+func ApplyCandidate(ctx context.Context, basicRaw, coreRaw string) error {
+	return defaultClient.ApplyCandidate(ctx, basicRaw, coreRaw)
+}
+
+// ApplyCandidate runs the two-phase validate/stage/commit protocol described
+// in the package-level ApplyCandidate documentation.
+func (c *client) ApplyCandidate(ctx context.Context, basicRaw, coreRaw string) error {
+	// applyMu serializes the whole validate/stage/commit sequence, so two
+	// concurrent edits can't interleave (e.g. both pass validation against a
+	// now-stale "old" document, then each roll back the other's commit).
+	c.applyMu.Lock()
+	defer c.applyMu.Unlock()
+
+	candidate, err := parseCandidate(basicRaw, coreRaw)
+	if err != nil {
+		return errors.Wrap(err, "candidate configuration is invalid")
+	}
+
+	if err := runValidators(candidate); err != nil {
+		return errors.Wrap(err, "candidate configuration failed validation")
+	}
+
+	if err := c.runStagedWatchers(ctx, candidate); err != nil {
+		return errors.Wrap(err, "a subsystem rejected the candidate configuration")
+	}
+
+	// Only now, after every validator and staged watcher has accepted the
+	// candidate, do we touch the live stores that Get() and every background
+	// fetch read from.
+	c.docMu.Lock()
+	oldBasicRaw, oldCoreRaw := c.basicRaw, c.coreRaw
+	c.docMu.Unlock()
+
+	if _, err := c.basicStore.MaybeUpdate(basicRaw); err != nil {
+		return errors.Wrap(err, "committing candidate basic configuration")
+	}
+	if _, err := c.coreStore.MaybeUpdate(coreRaw); err != nil {
+		c.rollback(oldBasicRaw, oldCoreRaw)
+		return errors.Wrap(err, "committing candidate core configuration")
+	}
+
+	c.docMu.Lock()
+	c.basicRaw, c.coreRaw = basicRaw, coreRaw
+	c.docMu.Unlock()
+
+	c.notifyWatchers()
+	basicChange := c.notifyChangeWatchers(oldBasicRaw, basicRaw)
+	coreChange := c.notifyChangeWatchers(oldCoreRaw, coreRaw)
+	c.appendAudit(ctx, basicChange)
+	c.appendAudit(ctx, coreChange)
+	return nil
+}
+
+// parseCandidate unmarshals basicRaw/coreRaw into a *SiteConfiguration
+// without touching basicStore/coreStore, so Validators and StagedWatchers can
+// be run against it before any reader can observe it. Comments are stripped
+// first, since site configuration documents are JSONC.
+func parseCandidate(basicRaw, coreRaw string) (*SiteConfiguration, error) {
+	var basic schema.BasicSiteConfiguration
+	if err := json.Unmarshal([]byte(loader.StripComments(basicRaw)), &basic); err != nil {
+		return nil, errors.Wrap(err, "parsing candidate basic configuration")
+	}
+	var core schema.CoreSiteConfiguration
+	if err := json.Unmarshal([]byte(loader.StripComments(coreRaw)), &core); err != nil {
+		return nil, errors.Wrap(err, "parsing candidate core configuration")
+	}
+	return &SiteConfiguration{Basic: &basic, Core: &core}, nil
+}
+
+// rollback restores oldBasicRaw into basicStore after a candidate's core
+// half fails to commit, so the two stores don't end up holding mismatched
+// candidate/previous documents. It only logs on failure: by the time
+// rollback is called the candidate has already been rejected, so there's no
+// error left to surface to the submitter beyond the original rejection
+// reason.
+func (c *client) rollback(oldBasicRaw, oldCoreRaw string) {
+	if oldBasicRaw != "" {
+		if _, err := c.basicStore.MaybeUpdate(oldBasicRaw); err != nil {
+			log.Printf("conf: failed to roll back basic configuration after a rejected candidate: %s", err)
+		}
+	}
+}
+
+// runStagedWatchers calls every registered StagedWatcher concurrently with
+// candidate, waiting up to StagedWatcherTimeout for all of them to respond.
+// The first error from any watcher (or a timeout) is returned; remaining
+// watchers' results are discarded.
+func (c *client) runStagedWatchers(ctx context.Context, candidate *SiteConfiguration) error {
+	c.stagedWatchersMu.Lock()
+	watchers := make([]StagedWatcher, len(c.stagedWatchers))
+	copy(watchers, c.stagedWatchers)
+	c.stagedWatchersMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, StagedWatcherTimeout)
+	defer cancel()
+
+	errs := make(chan error, len(watchers))
+	for _, w := range watchers {
+		w := w
+		go func() { errs <- w(candidate) }()
+	}
+
+	for range watchers {
+		select {
+		case err := <-errs:
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return errors.New("timed out waiting for a subsystem to accept the candidate configuration")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Package audit implements an append-only JSONL log of accepted
+// configuration changes, so operators can answer "who changed
+// auth.providers last Tuesday?" instead of the current opaque
+// overwrite model, where only the latest document is kept.
+//
+// conf.ApplyCandidate is the writer: once conf.SetAuditLog has installed a
+// Log, each document an accepted edit changes is recorded via Log.Append
+// with the submitter's context (so the actor can be attributed via
+// WithActor) and the []conf.ConfigFieldChange patch computed for it. An
+// internal HTTP handler can then serve the log back out for operators (see
+// Log.Entries).
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is one line of the audit log.
+type Entry struct {
+	Actor     string      `json:"actor"`
+	Timestamp time.Time   `json:"timestamp"`
+	Revision  int         `json:"revision"`
+	Patch     interface{} `json:"patch"`
+}
+
+type actorKey struct{}
+
+// WithActor returns a context that attributes subsequent Log.Append calls to
+// actor (e.g. the authenticated username that submitted the edit).
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set by WithActor, or "unknown" if none
+// was set.
+func ActorFromContext(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return "unknown"
+}
+
+// Log is an append-only JSONL audit log of accepted configuration changes.
+type Log struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Open opens (creating if necessary) the audit log file at path for both
+// appending (Append) and reading back (Entries).
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{file: f}, nil
+}
+
+// Append records one accepted change, attributing it to the actor in ctx (see
+// WithActor). patch is typically a []conf.ConfigFieldChange; it's left as
+// interface{} so this package doesn't need to import conf.
+func (l *Log) Append(ctx context.Context, revision int, patch interface{}) error {
+	entry := Entry{
+		Actor:     ActorFromContext(ctx),
+		Timestamp: time.Now(),
+		Revision:  revision,
+		Patch:     patch,
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.file.Write(line)
+	return err
+}
+
+// Entries reads back every entry recorded so far, in append order. It is
+// meant to back the internal "who changed this last" endpoint; callers
+// needing only recent history should paginate on the returned slice
+// themselves, since the log has no built-in index.
+func (l *Log) Entries() ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.file.Seek(0, os.SEEK_SET); err != nil {
+		return nil, err
+	}
+	defer l.file.Seek(0, os.SEEK_END)
+
+	var entries []Entry
+	scanner := bufio.NewScanner(l.file)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// Close closes the underlying file.
+func (l *Log) Close() error {
+	return l.file.Close()
+}
@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogAppendEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	defer l.Close()
+
+	ctx := WithActor(context.Background(), "alice")
+	if err := l.Append(ctx, 1, map[string]string{"field": "auth.providers"}); err != nil {
+		t.Fatalf("Append: %s", err)
+	}
+	if err := l.Append(context.Background(), 2, map[string]string{"field": "externalURL"}); err != nil {
+		t.Fatalf("Append: %s", err)
+	}
+
+	entries, err := l.Entries()
+	if err != nil {
+		t.Fatalf("Entries: %s", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if entries[0].Actor != "alice" || entries[0].Revision != 1 {
+		t.Errorf("entries[0] = %+v, want actor alice, revision 1", entries[0])
+	}
+	if entries[1].Actor != "unknown" || entries[1].Revision != 2 {
+		t.Errorf("entries[1] = %+v, want actor unknown, revision 2", entries[1])
+	}
+
+	// Entries must be callable again (the file position should be restored),
+	// and Append must still work after a read.
+	if _, err := l.Entries(); err != nil {
+		t.Fatalf("second Entries call: %s", err)
+	}
+	if err := l.Append(context.Background(), 3, nil); err != nil {
+		t.Fatalf("Append after Entries: %s", err)
+	}
+	entries, err = l.Entries()
+	if err != nil {
+		t.Fatalf("Entries after Append: %s", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3", len(entries))
+	}
+}
+
+func TestOpenReopensExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	l1, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %s", err)
+	}
+	if err := l1.Append(context.Background(), 1, nil); err != nil {
+		t.Fatalf("Append: %s", err)
+	}
+	if err := l1.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+
+	l2, err := Open(path)
+	if err != nil {
+		t.Fatalf("reopening: %s", err)
+	}
+	defer l2.Close()
+
+	entries, err := l2.Entries()
+	if err != nil {
+		t.Fatalf("Entries: %s", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("Stat: %s", err)
+	}
+}
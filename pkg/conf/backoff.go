@@ -0,0 +1,77 @@
+package conf
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// BackoffConfig controls how long continuouslyUpdate waits between fetches.
+// Successful fetches use BaseInterval (with jitter); consecutive failures
+// back off exponentially up to MaxInterval so a misbehaving or unreachable
+// configuration source doesn't get hammered.
+type BackoffConfig struct {
+	// BaseInterval is the interval used between fetches once the server is
+	// healthy (i.e. after a successful fetch resets the error count).
+	BaseInterval time.Duration
+
+	// Jitter is the fraction of BaseInterval/the current backoff interval to
+	// randomly add or subtract, to avoid every replica polling in lockstep.
+	// 0.2 means ±20%.
+	Jitter float64
+
+	// MaxInterval caps the exponential backoff applied after consecutive
+	// fetch errors.
+	MaxInterval time.Duration
+}
+
+// DefaultBackoffConfig is used by clients that don't call WithBackoff.
+var DefaultBackoffConfig = BackoffConfig{
+	BaseInterval: 5 * time.Second,
+	Jitter:       0.2,
+	MaxInterval:  5 * time.Minute,
+}
+
+// WithBackoff overrides the default client's polling backoff policy.
+//
+// WithBackoff is a wrapper around client.WithBackoff.
+func WithBackoff(cfg BackoffConfig) {
+	defaultClient.WithBackoff(cfg)
+}
+
+// WithBackoff overrides the client's polling backoff policy. It returns c so
+// it can be chained with other constructor-time configuration.
+func (c *client) WithBackoff(cfg BackoffConfig) *client {
+	c.backoffConfig = cfg
+	return c
+}
+
+// nextInterval returns how long to wait before the next fetch attempt, given
+// the number of consecutive errors seen so far (0 means the last fetch
+// succeeded). The result always has jitter applied.
+func (c *client) nextInterval(consecutiveErrors int) time.Duration {
+	cfg := c.backoffConfig
+	if cfg.BaseInterval == 0 {
+		cfg = DefaultBackoffConfig
+	}
+
+	interval := cfg.BaseInterval
+	if consecutiveErrors > 0 {
+		// Exponential backoff: base * 2^(errors-1), capped at MaxInterval.
+		interval = cfg.BaseInterval * time.Duration(math.Pow(2, float64(consecutiveErrors-1)))
+		if interval > cfg.MaxInterval {
+			interval = cfg.MaxInterval
+		}
+	}
+
+	if cfg.Jitter <= 0 {
+		return interval
+	}
+	delta := float64(interval) * cfg.Jitter
+	// Uniformly distribute in [interval-delta, interval+delta].
+	jittered := float64(interval) + (rand.Float64()*2-1)*delta
+	if jittered < 0 {
+		jittered = 0
+	}
+	return time.Duration(jittered)
+}
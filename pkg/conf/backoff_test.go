@@ -0,0 +1,51 @@
+package conf
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextIntervalNoJitter(t *testing.T) {
+	c := (&client{}).WithBackoff(BackoffConfig{
+		BaseInterval: 10 * time.Second,
+		MaxInterval:  40 * time.Second,
+	})
+
+	tests := []struct {
+		consecutiveErrors int
+		want              time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{4, 40 * time.Second}, // capped at MaxInterval
+	}
+	for _, tt := range tests {
+		if got := c.nextInterval(tt.consecutiveErrors); got != tt.want {
+			t.Errorf("nextInterval(%d) = %s, want %s", tt.consecutiveErrors, got, tt.want)
+		}
+	}
+}
+
+func TestNextIntervalJitterBounded(t *testing.T) {
+	c := (&client{}).WithBackoff(BackoffConfig{
+		BaseInterval: 10 * time.Second,
+		Jitter:       0.2,
+		MaxInterval:  time.Minute,
+	})
+
+	for i := 0; i < 100; i++ {
+		got := c.nextInterval(0)
+		if got < 8*time.Second || got > 12*time.Second {
+			t.Fatalf("nextInterval(0) = %s, want within ±20%% of 10s", got)
+		}
+	}
+}
+
+func TestNextIntervalDefaultsWhenUnconfigured(t *testing.T) {
+	c := &client{}
+	if got := c.nextInterval(0); got < DefaultBackoffConfig.BaseInterval*8/10 || got > DefaultBackoffConfig.BaseInterval*12/10 {
+		t.Errorf("nextInterval(0) on an unconfigured client = %s, want close to DefaultBackoffConfig.BaseInterval (%s)", got, DefaultBackoffConfig.BaseInterval)
+	}
+}
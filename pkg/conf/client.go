@@ -3,7 +3,6 @@ package conf
 import (
 	"context"
 	"log"
-	"math/rand"
 	"sync"
 	"time"
 
@@ -11,6 +10,8 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/globals"
 	"github.com/sourcegraph/sourcegraph/pkg/api"
+	"github.com/sourcegraph/sourcegraph/pkg/conf/audit"
+	"github.com/sourcegraph/sourcegraph/pkg/conf/loader"
 	"github.com/sourcegraph/sourcegraph/pkg/conf/store"
 	"github.com/sourcegraph/sourcegraph/schema"
 )
@@ -22,8 +23,42 @@ type client struct {
 	coreStore   *store.CoreStore
 	coreFetcher coreFetcher
 
+	// docMu guards basicVersion/basicRaw/coreVersion/coreRaw, which are
+	// written by the background continuouslyUpdate goroutine and by
+	// ApplyCandidate (called from request-handling goroutines), and read by
+	// both.
+	docMu        sync.Mutex
+	basicVersion int
+	basicRaw     string
+	coreVersion  int
+	coreRaw      string
+
+	// applyMu serializes ApplyCandidate calls, so two concurrent edits can't
+	// interleave their validate/stage/commit phases.
+	applyMu sync.Mutex
+
+	// backoffConfig controls the interval between fetches; see BackoffConfig.
+	// The zero value means DefaultBackoffConfig is used.
+	backoffConfig BackoffConfig
+
 	watchersMu sync.Mutex
 	watchers   []chan struct{}
+
+	revisionMu       sync.Mutex
+	revision         int
+	changeWatchersMu sync.Mutex
+	changeWatchers   []chan ConfigChange
+
+	stagedWatchersMu sync.Mutex
+	stagedWatchers   []StagedWatcher
+
+	auditLogMu sync.Mutex
+	auditLog   *audit.Log
+
+	// shuttingDown is closed once Run's context is cancelled, so that
+	// goroutines spawned by Watch can stop waiting on a watcher channel that
+	// will never receive again.
+	shuttingDown chan struct{}
 }
 
 var defaultClient *client
@@ -33,8 +68,11 @@ type SiteConfiguration struct {
 	Core  *schema.CoreSiteConfiguration
 }
 
-// Get returns a copy of the configuration. The returned value should NEVER be
-// modified.
+// Get returns a read-only view of the configuration. The interface it
+// returns exposes only getters, so unlike the old *SiteConfiguration struct
+// it is not possible to modify the shared cached config by accident; callers
+// that genuinely need the struct (e.g. to deep-copy it) should use
+// GetMutable instead.
 //
 // Important: The configuration can change while the process is running! Code
 // should only call this in response to conf.Watch OR it should invoke it
@@ -49,28 +87,16 @@ type SiteConfiguration struct {
 // is running.
 //
 // Get is a wrapper around client.Get.
-func Get() *SiteConfiguration {
+func Get() *ReadOnlySiteConfiguration {
 	return defaultClient.Get()
 }
 
-// Get returns a copy of the configuration. The returned value should NEVER be
-// modified.
-//
-// Important: The configuration can change while the process is running! Code
-// should only call this in response to conf.Watch OR it should invoke it
-// periodically or in direct response to a user action (e.g. inside an HTTP
-// handler) to ensure it responds to configuration changes while the process
-// is running.
-//
-// There are a select few configuration options that do restart the server (for
-// example, TLS or which port the frontend listens on) but these are the
-// exception rather than the rule. In general, ANY use of configuration should
-// be done in such a way that it responds to config changes while the process
-// is running.
-func (c *client) Get() *SiteConfiguration {
-	return &SiteConfiguration{
-		Basic: c.basicStore.LastValid(),
-		Core:  c.coreStore.LastValid(),
+// Get returns a read-only view of the configuration. See the package-level
+// Get documentation for details.
+func (c *client) Get() *ReadOnlySiteConfiguration {
+	return &ReadOnlySiteConfiguration{
+		Basic: readOnlyBasic{basic: c.basicStore.LastValid()},
+		Core:  readOnlyCore{core: c.coreStore.LastValid()},
 	}
 }
 
@@ -80,7 +106,7 @@ func (c *client) Get() *SiteConfiguration {
 // use conf.Watch). See Get documentation for more details.
 //
 // GetTODO is a wrapper around client.GetTODO.
-func GetTODO() *SiteConfiguration {
+func GetTODO() *ReadOnlySiteConfiguration {
 	return defaultClient.GetTODO()
 }
 
@@ -88,7 +114,7 @@ func GetTODO() *SiteConfiguration {
 // The code may need to be updated to use conf.Watch, or it may already be e.g.
 // invoked only in response to a user action (in which case it does not need to
 // use conf.Watch). See Get documentation for more details.
-func (c *client) GetTODO() *SiteConfiguration {
+func (c *client) GetTODO() *ReadOnlySiteConfiguration {
 	return c.Get()
 }
 
@@ -148,8 +174,12 @@ func (c *client) Watch(f func()) {
 	go func() {
 		// Invoke f when the configuration has changed.
 		for {
-			<-notify
-			f()
+			select {
+			case <-notify:
+				f()
+			case <-c.shuttingDown:
+				return
+			}
 		}
 	}()
 }
@@ -173,24 +203,182 @@ func (c *client) notifyWatchers() {
 	}
 }
 
-func (c *client) continuouslyUpdate() {
+// WatchChanges calls f in a separate goroutine with a ConfigChange describing
+// each accepted configuration update: the JSON-pointer paths that changed,
+// their old/new values, and the revision the update was assigned. Unlike
+// Watch, f is not invoked with the current configuration up front, since
+// there is no "change" to describe until the first update after
+// subscribing.
+//
+// WatchChanges is a wrapper around client.WatchChanges.
+func WatchChanges(f func(ConfigChange)) {
+	defaultClient.WatchChanges(f)
+}
+
+// WatchChanges calls f in a separate goroutine with a ConfigChange describing
+// each accepted configuration update. See the package-level WatchChanges
+// documentation for details.
+func (c *client) WatchChanges(f func(ConfigChange)) {
+	notify := make(chan ConfigChange, 16)
+	c.changeWatchersMu.Lock()
+	c.changeWatchers = append(c.changeWatchers, notify)
+	c.changeWatchersMu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case change := <-notify:
+				f(change)
+			case <-c.shuttingDown:
+				return
+			}
+		}
+	}()
+}
+
+// notifyChangeWatchers computes the structural diff between oldRaw and
+// newRaw and, if it is non-empty, assigns it the next revision, delivers it
+// to every WatchChanges subscriber, and returns it (nil if there was nothing
+// to report) so callers that need it for other purposes (e.g. ApplyCandidate
+// appending to the audit log) don't have to recompute it.
+func (c *client) notifyChangeWatchers(oldRaw, newRaw string) *ConfigChange {
+	changes, err := diffRawConfig(oldRaw, newRaw)
+	if err != nil {
+		log.Printf("conf: unable to compute configuration diff for WatchChanges subscribers: %s", err)
+		return nil
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	c.revisionMu.Lock()
+	c.revision++
+	change := ConfigChange{Revision: c.revision, Changes: changes}
+	c.revisionMu.Unlock()
+
+	c.changeWatchersMu.Lock()
+	for _, watcher := range c.changeWatchers {
+		select {
+		case watcher <- change:
+		default:
+			log.Printf("conf: dropped a ConfigChange notification because a WatchChanges subscriber is falling behind")
+		}
+	}
+	c.changeWatchersMu.Unlock()
+
+	return &change
+}
+
+// SetAuditLog installs l as the destination for an append-only record of
+// every configuration change accepted via ApplyCandidate. It is typically
+// called once, during confserver startup, with a log opened from a path
+// derived from SOURCEGRAPH_CONFIG_FILE.
+//
+// SetAuditLog is a wrapper around client.SetAuditLog.
+func SetAuditLog(l *audit.Log) {
+	defaultClient.SetAuditLog(l)
+}
+
+// SetAuditLog installs l as the destination for accepted configuration
+// changes. See the package-level SetAuditLog documentation for details.
+func (c *client) SetAuditLog(l *audit.Log) {
+	c.auditLogMu.Lock()
+	defer c.auditLogMu.Unlock()
+	c.auditLog = l
+}
+
+// appendAudit records change in the audit log installed via SetAuditLog, if
+// any. change may be nil (nothing to report, e.g. the candidate was
+// byte-identical to what's already live); appendAudit is then a no-op. A
+// failure to append is logged but never surfaced to the submitter: by the
+// time this is called the candidate has already been accepted, and the
+// audit trail is a secondary concern to the edit itself succeeding.
+func (c *client) appendAudit(ctx context.Context, change *ConfigChange) {
+	if change == nil {
+		return
+	}
+
+	c.auditLogMu.Lock()
+	l := c.auditLog
+	c.auditLogMu.Unlock()
+	if l == nil {
+		return
+	}
+
+	if err := l.Append(ctx, change.Revision, change.Changes); err != nil {
+		log.Printf("conf: failed to append accepted configuration change to the audit log: %s", err)
+	}
+}
+
+// Run drives the client's background update loop until ctx is cancelled,
+// matching the suture v4 Serve(ctx) error contract so the frontend's process
+// supervisor can manage its lifecycle like any other service. Run blocks
+// until shutdown is complete: in-flight fetches are cancelled via ctx,
+// goroutines spawned by Watch are released, and Run returns nil once
+// everything has stopped (a non-nil error indicates an unexpected failure,
+// not a requested shutdown).
+func (c *client) Run(ctx context.Context) error {
+	defer close(c.shuttingDown)
+	return c.continuouslyUpdate(ctx)
+}
+
+func (c *client) continuouslyUpdate(ctx context.Context) error {
+	consecutiveErrors := 0
+
+	// basicNotify/coreNotify let a Watcher-capable fetcher (e.g. a
+	// chainFetcher wrapping a loader.LoaderChain with a FileLoader or
+	// EtcdLoader in it) wake this loop as soon as the underlying source
+	// changes, rather than waiting for the next fixed-interval poll. A nil
+	// channel blocks forever in the select below, which is exactly the
+	// "this fetcher can't push updates" behavior we want.
+	basicNotify := notifyChan(c.basicFetcher)
+	coreNotify := notifyChan(c.coreFetcher)
+
 	for {
 		var errs *multierror.Error
 
-		errs = multierror.Append(errs, c.fetchAndUpdateBasic())
-		errs = multierror.Append(errs, c.fetchAndUpdateCore())
+		errs = multierror.Append(errs, c.fetchAndUpdateBasic(ctx))
+		errs = multierror.Append(errs, c.fetchAndUpdateCore(ctx))
 
-		if errs.ErrorOrNil() != nil {
-			log.Printf("received errors during background config updates, errs: %s", errs.ErrorOrNil())
+		if err := errs.ErrorOrNil(); err != nil {
+			log.Printf("received errors during background config updates, errs: %s", err)
+			consecutiveErrors++
+		} else {
+			consecutiveErrors = 0
 		}
 
-		jitter := time.Duration(rand.Int63n(5 * int64(time.Second)))
-		time.Sleep(jitter)
+		select {
+		case <-time.After(c.nextInterval(consecutiveErrors)):
+		case <-basicNotify:
+		case <-coreNotify:
+		case <-ctx.Done():
+			return nil
+		}
 	}
 }
 
-func (c *client) fetchAndUpdateBasic() error {
-	newRawConfig, err := c.basicFetcher.FetchBasicConfig()
+// notifier is implemented by fetchers that can push updates rather than
+// waiting to be polled; see loader.Watcher.
+type notifier interface {
+	Notify() <-chan struct{}
+}
+
+// notifyChan returns f's push-update channel if it implements notifier, or
+// nil otherwise.
+func notifyChan(f interface{}) <-chan struct{} {
+	if n, ok := f.(notifier); ok {
+		return n.Notify()
+	}
+	return nil
+}
+
+func (c *client) fetchAndUpdateBasic(ctx context.Context) error {
+	c.docMu.Lock()
+	sinceVersion := c.basicVersion
+	oldRaw := c.basicRaw
+	c.docMu.Unlock()
+
+	newRawConfig, newVersion, err := c.basicFetcher.FetchBasicConfig(ctx, sinceVersion)
 	if err != nil {
 		return errors.Wrap(err, "unable to fetch new basic configuration")
 	}
@@ -200,14 +388,27 @@ func (c *client) fetchAndUpdateBasic() error {
 		return errors.Wrap(err, "unable to update new basic configuration")
 	}
 
+	c.docMu.Lock()
+	c.basicVersion = newVersion
+	if configChange.Changed {
+		c.basicRaw = newRawConfig
+	}
+	c.docMu.Unlock()
+
 	if configChange.Changed {
 		c.notifyWatchers()
+		c.notifyChangeWatchers(oldRaw, newRawConfig)
 	}
 	return nil
 }
 
-func (c *client) fetchAndUpdateCore() error {
-	newRawConfig, err := c.coreFetcher.FetchCoreConfig()
+func (c *client) fetchAndUpdateCore(ctx context.Context) error {
+	c.docMu.Lock()
+	sinceVersion := c.coreVersion
+	oldRaw := c.coreRaw
+	c.docMu.Unlock()
+
+	newRawConfig, newVersion, err := c.coreFetcher.FetchCoreConfig(ctx, sinceVersion)
 	if err != nil {
 		return errors.Wrap(err, "unable to fetch new core configuration")
 	}
@@ -217,22 +418,38 @@ func (c *client) fetchAndUpdateCore() error {
 		return errors.Wrap(err, "unable to update new core configuration")
 	}
 
+	c.docMu.Lock()
+	c.coreVersion = newVersion
+	if configChange.Changed {
+		c.coreRaw = newRawConfig
+	}
+	c.docMu.Unlock()
+
 	if configChange.Changed {
 		c.notifyWatchers()
+		c.notifyChangeWatchers(oldRaw, newRawConfig)
 	}
 	return nil
 }
 
+// basicFetcher fetches the raw basic configuration JSON. sinceVersion is a
+// cursor previously returned by FetchBasicConfig (0 initially); fetchers that
+// support long-polling block until the configuration differs from
+// sinceVersion or ctx is done, and return the new cursor. Fetchers that don't
+// support long-polling (e.g. the in-process passthrough) ignore sinceVersion
+// and always return version 0.
 type basicFetcher interface {
-	FetchBasicConfig() (rawJSON string, err error)
+	FetchBasicConfig(ctx context.Context, sinceVersion int) (rawJSON string, newVersion int, err error)
 }
 
-// Fetch the raw configuration JSON via our internal API.
+// Fetch the raw configuration JSON via our internal API, long-polling so
+// that updates propagate as soon as the server has them rather than waiting
+// for the next fixed-interval poll.
 type httpBasicFetcher struct{}
 
-func (h httpBasicFetcher) FetchBasicConfig() (string, error) {
-	rawJSON, err := api.InternalClient.ConfigurationBasicRawJSON(context.Background())
-	return rawJSON, err
+func (h httpBasicFetcher) FetchBasicConfig(ctx context.Context, sinceVersion int) (string, int, error) {
+	rawJSON, version, err := api.InternalClient.ConfigurationBasicRawJSON(ctx, sinceVersion)
+	return rawJSON, version, err
 }
 
 // Fetch the raw configuration directly via conf.DefaultServerFrontendOnly.
@@ -244,20 +461,59 @@ func (h httpBasicFetcher) FetchBasicConfig() (string, error) {
 // that attempt to use it will panic.
 type passthroughBasicFetcherFrontendOnly struct{}
 
-func (p passthroughBasicFetcherFrontendOnly) FetchBasicConfig() (string, error) {
-	return globals.ConfigurationServerFrontendOnly.RawBasic(), nil
+func (p passthroughBasicFetcherFrontendOnly) FetchBasicConfig(ctx context.Context, sinceVersion int) (string, int, error) {
+	return globals.ConfigurationServerFrontendOnly.RawBasic(), 0, nil
 }
 
+// chainFetcher adapts a *loader.LoaderChain to the basicFetcher/coreFetcher
+// interfaces (conf.go's init gives basicFetcher and coreFetcher each their
+// own chainFetcher value, with only the matching chain set), so the merged
+// result flows through basicStore/coreStore exactly like any other fetcher
+// and Watch semantics are unaffected. LoaderChain does not support
+// long-polling, so it always returns version 0; changes are picked up by
+// continuouslyUpdate's polling, or sooner via Notify when a loader in the
+// chain can push them.
+type chainFetcher struct {
+	basicChain *loader.LoaderChain
+	coreChain  *loader.LoaderChain
+}
+
+func (c chainFetcher) FetchBasicConfig(ctx context.Context, sinceVersion int) (string, int, error) {
+	rawJSON, err := c.basicChain.Load()
+	return rawJSON, 0, err
+}
+
+func (c chainFetcher) FetchCoreConfig(ctx context.Context, sinceVersion int) (string, int, error) {
+	rawJSON, err := c.coreChain.Load()
+	return rawJSON, 0, err
+}
+
+// Notify implements notifier by delegating to whichever chain this
+// chainFetcher was built with (basicFetcher and coreFetcher each get their
+// own chainFetcher value, so at most one of basicChain/coreChain is set; see
+// conf.go's init). This is what lets a Watcher-capable loader (e.g.
+// loader.FileLoader, loader.EtcdLoader) wake continuouslyUpdate immediately
+// instead of waiting for the next fixed-interval poll.
+func (c chainFetcher) Notify() <-chan struct{} {
+	if c.basicChain != nil {
+		return c.basicChain.Notify()
+	}
+	return c.coreChain.Notify()
+}
+
+// coreFetcher is the core-configuration analogue of basicFetcher; see its
+// docs for the sinceVersion/newVersion long-poll contract.
 type coreFetcher interface {
-	FetchCoreConfig() (rawJSON string, err error)
+	FetchCoreConfig(ctx context.Context, sinceVersion int) (rawJSON string, newVersion int, err error)
 }
 
-// Fetch the raw configuration JSON via our internal API.
+// Fetch the raw configuration JSON via our internal API, long-polling like
+// httpBasicFetcher.
 type httpCoreFetcher struct{}
 
-func (h httpCoreFetcher) FetchCoreConfig() (string, error) {
-	rawJSON, err := api.InternalClient.ConfigurationCoreRawJSON(context.Background())
-	return rawJSON, err
+func (h httpCoreFetcher) FetchCoreConfig(ctx context.Context, sinceVersion int) (string, int, error) {
+	rawJSON, version, err := api.InternalClient.ConfigurationCoreRawJSON(ctx, sinceVersion)
+	return rawJSON, version, err
 }
 
 // Fetch the raw configuration directly via conf.DefaultServerFrontendOnly.
@@ -269,6 +525,6 @@ func (h httpCoreFetcher) FetchCoreConfig() (string, error) {
 // that attempt to use it will panic.
 type passthroughCoreFetcherFrontendOnly struct{}
 
-func (p passthroughCoreFetcherFrontendOnly) FetchCoreConfig() (string, error) {
-	return globals.ConfigurationServerFrontendOnly.RawCore(), nil
-}
\ No newline at end of file
+func (p passthroughCoreFetcherFrontendOnly) FetchCoreConfig(ctx context.Context, sinceVersion int) (string, int, error) {
+	return globals.ConfigurationServerFrontendOnly.RawCore(), 0, nil
+}
@@ -1,14 +1,21 @@
 package conf
 
 import (
+	"context"
+	"encoding/json"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	vaultapi "github.com/hashicorp/vault/api"
 	"github.com/sourcegraph/jsonx"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/globals"
 	"github.com/sourcegraph/sourcegraph/cmd/frontend/globals/confserver"
+	"github.com/sourcegraph/sourcegraph/pkg/conf/loader"
 	"github.com/sourcegraph/sourcegraph/pkg/conf/store"
+	clientv3 "go.etcd.io/etcd/clientv3"
 )
 
 type configurationMode int
@@ -46,6 +53,24 @@ func getMode() configurationMode {
 	}
 }
 
+// rootCtx is cancelled by Stop, and is the context the package's own
+// background goroutines (the default client's update loop in modeClient,
+// and confserver's Serve in modeServer) are started with. Without this, a
+// context.Background() passed to a long-running goroutine can never be
+// cancelled, so nothing short of process exit stops it -- defeating the
+// point of the context.Context-based shutdown plumbed through client.Run
+// and confserver.Serve.
+var rootCtx, rootCancel = context.WithCancel(context.Background())
+
+// Stop cancels the context used by this package's own background
+// goroutines, giving callers (e.g. a signal handler coordinating graceful
+// shutdown across a process's services) a way to ask confserver to flush
+// pending edits and the background update loop to exit, rather than
+// relying on the process dying uncleanly.
+func Stop() {
+	rootCancel()
+}
+
 func init() {
 	clientBasicStore := store.NewBasicStore()
 	clientCoreStore := store.NewCoreStore()
@@ -55,6 +80,7 @@ func init() {
 		coreStore:    clientCoreStore,
 		basicFetcher: httpBasicFetcher{},
 		coreFetcher:  httpCoreFetcher{},
+		shuttingDown: make(chan struct{}),
 	}
 
 	mode := getMode()
@@ -86,14 +112,187 @@ func init() {
 	// If the caller of pkg/conf is the frontend service, instantiate the DefaultServerFrontendOnly
 	// and install the passthrough fetcher for defaultClient in order to avoid deadlock issues.
 	if mode == modeServer {
-		globals.ConfigurationServerFrontendOnly = confserver.NewServer(os.Getenv("SOURCEGRAPH_CONFIG_FILE"), os.Getenv("SOURCEGRAPH_CONFIG_CORE_FILE"))
+		// Pass loader.Redact so confserver strips the fields listed in
+		// loader.SecretPaths from RawBasic/RawCore before serving them to
+		// other services; a Vault-loaded value at any other path is served
+		// as it is.
+		globals.ConfigurationServerFrontendOnly = confserver.NewServer(os.Getenv("SOURCEGRAPH_CONFIG_FILE"), os.Getenv("SOURCEGRAPH_CONFIG_CORE_FILE"), loader.Redact)
 
-		globals.ConfigurationServerFrontendOnly.Start()
+		go func() {
+			if err := globals.ConfigurationServerFrontendOnly.Serve(rootCtx); err != nil {
+				log.Printf("confserver: exited with error: %s", err)
+			}
+		}()
 		defaultClient.basicFetcher = passthroughBasicFetcherFrontendOnly{}
 		defaultClient.coreFetcher = passthroughCoreFetcherFrontendOnly{}
+
+		basicChain, coreChain := newConfiguredLoaderChains()
+		if basicChain != nil {
+			defaultClient.basicFetcher = chainFetcher{basicChain: basicChain}
+		}
+		if coreChain != nil {
+			defaultClient.coreFetcher = chainFetcher{coreChain: coreChain}
+		}
+
+		// The frontend's process supervisor drives defaultClient.Run itself
+		// (see conf.Run), so that shutdown can be coordinated with the rest
+		// of the process instead of leaking a background goroutine.
+		return
 	}
 
-	go defaultClient.continuouslyUpdate()
+	go func() {
+		if err := defaultClient.Run(rootCtx); err != nil {
+			log.Printf("conf: background update loop exited with error: %s", err)
+		}
+	}()
+}
+
+// Run drives the default client's background configuration update loop
+// until ctx is cancelled. The frontend's process supervisor calls this
+// directly (instead of relying on the fire-and-forget goroutine other
+// services get from init) so that shutdown can be sequenced: in-flight
+// fetches are cancelled, watchers are released, and any pending confserver
+// edits are flushed before the process exits.
+//
+// Run is a wrapper around client.Run.
+func Run(ctx context.Context) error {
+	return defaultClient.Run(ctx)
+}
+
+// newConfiguredLoaderChains builds a *loader.LoaderChain for the basic
+// document and one for the core document from the SOURCEGRAPH_CONFIG_LOADERS
+// environment variable, a comma-separated list of loader names (e.g.
+// "file,env,vault") evaluated left-to-right so later entries override
+// earlier ones. basic and core are nil independently of one another when
+// that document ends up with no configured loaders (e.g.
+// SOURCEGRAPH_CONFIG_CORE_FILE is set but SOURCEGRAPH_CONFIG_FILE isn't), so
+// the caller can fall back to its existing fetcher for just that document
+// instead of pinning it to an empty chain.
+//
+// "file" and "http" read from basic- and core-specific environment
+// variables (SOURCEGRAPH_CONFIG_FILE/SOURCEGRAPH_CONFIG_CORE_FILE,
+// SOURCEGRAPH_CONFIG_HTTP_URL/SOURCEGRAPH_CONFIG_CORE_HTTP_URL) since the two
+// documents are typically backed by different sources; "env" and "vault"
+// contribute the same loader to both chains, since env vars and Vault
+// secrets aren't namespaced by document. "etcd" likewise shares one watched
+// key across both chains unless SOURCEGRAPH_CONFIG_ETCD_CORE_KEY is set.
+func newConfiguredLoaderChains() (basic, core *loader.LoaderChain) {
+	names := os.Getenv("SOURCEGRAPH_CONFIG_LOADERS")
+	if names == "" {
+		return nil, nil
+	}
+
+	var basicLoaders, coreLoaders []loader.Loader
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "file":
+			if path := os.Getenv("SOURCEGRAPH_CONFIG_FILE"); path != "" {
+				l, err := loader.NewFileLoader(path)
+				if err != nil {
+					log.Fatalf("conf: configuring basic file loader: %s", err)
+				}
+				basicLoaders = append(basicLoaders, l)
+			}
+			if path := os.Getenv("SOURCEGRAPH_CONFIG_CORE_FILE"); path != "" {
+				l, err := loader.NewFileLoader(path)
+				if err != nil {
+					log.Fatalf("conf: configuring core file loader: %s", err)
+				}
+				coreLoaders = append(coreLoaders, l)
+			}
+		case "env":
+			envLoader := loader.NewEnvLoader()
+			basicLoaders = append(basicLoaders, envLoader)
+			coreLoaders = append(coreLoaders, envLoader)
+		case "http":
+			if url := os.Getenv("SOURCEGRAPH_CONFIG_HTTP_URL"); url != "" {
+				basicLoaders = append(basicLoaders, loader.NewHTTPLoader(url, 30*time.Second))
+			}
+			if url := os.Getenv("SOURCEGRAPH_CONFIG_CORE_HTTP_URL"); url != "" {
+				coreLoaders = append(coreLoaders, loader.NewHTTPLoader(url, 30*time.Second))
+			}
+		case "vault":
+			if l := newConfiguredVaultLoader(); l != nil {
+				basicLoaders = append(basicLoaders, l)
+				coreLoaders = append(coreLoaders, l)
+			}
+		case "etcd":
+			basicLoader, coreLoader := newConfiguredEtcdLoaders()
+			if basicLoader != nil {
+				basicLoaders = append(basicLoaders, basicLoader)
+			}
+			if coreLoader != nil {
+				coreLoaders = append(coreLoaders, coreLoader)
+			}
+		default:
+			log.Printf("conf: ignoring unknown entry %q in SOURCEGRAPH_CONFIG_LOADERS", name)
+		}
+	}
+	if len(basicLoaders) > 0 {
+		basic = loader.NewLoaderChain(basicLoaders...)
+	}
+	if len(coreLoaders) > 0 {
+		core = loader.NewLoaderChain(coreLoaders...)
+	}
+	return basic, core
+}
+
+// newConfiguredVaultLoader builds a *loader.VaultLoader from well-known
+// environment variables, or returns nil if Vault isn't configured.
+// VAULT_ADDR/VAULT_TOKEN are read by vaultapi.DefaultConfig() itself;
+// SOURCEGRAPH_CONFIG_VAULT_MAPPING is a JSON object mapping each Vault
+// secret path to the "/"-separated JSON path it should be written to, e.g.
+// {"secret/smtp": "email/smtp/password"}.
+func newConfiguredVaultLoader() *loader.VaultLoader {
+	rawMapping := os.Getenv("SOURCEGRAPH_CONFIG_VAULT_MAPPING")
+	if rawMapping == "" {
+		log.Printf("conf: ignoring \"vault\" in SOURCEGRAPH_CONFIG_LOADERS: SOURCEGRAPH_CONFIG_VAULT_MAPPING is unset")
+		return nil
+	}
+	var pathMapping map[string]string
+	if err := json.Unmarshal([]byte(rawMapping), &pathMapping); err != nil {
+		log.Fatalf("conf: parsing SOURCEGRAPH_CONFIG_VAULT_MAPPING: %s", err)
+	}
+	mapping := make(map[string][]string, len(pathMapping))
+	for secretPath, jsonPath := range pathMapping {
+		mapping[secretPath] = strings.Split(jsonPath, "/")
+	}
+
+	client, err := vaultapi.NewClient(vaultapi.DefaultConfig())
+	if err != nil {
+		log.Fatalf("conf: configuring vault client: %s", err)
+	}
+	return loader.NewVaultLoader(rootCtx, client, mapping)
+}
+
+// newConfiguredEtcdLoaders builds the basic and core *loader.EtcdLoader from
+// well-known environment variables, or returns (nil, nil) if etcd isn't
+// configured. Both documents share one watched key
+// (SOURCEGRAPH_CONFIG_ETCD_KEY) unless SOURCEGRAPH_CONFIG_ETCD_CORE_KEY is
+// also set.
+func newConfiguredEtcdLoaders() (basic, core *loader.EtcdLoader) {
+	endpoints := os.Getenv("SOURCEGRAPH_CONFIG_ETCD_ENDPOINTS")
+	key := os.Getenv("SOURCEGRAPH_CONFIG_ETCD_KEY")
+	if endpoints == "" || key == "" {
+		log.Printf("conf: ignoring \"etcd\" in SOURCEGRAPH_CONFIG_LOADERS: SOURCEGRAPH_CONFIG_ETCD_ENDPOINTS/SOURCEGRAPH_CONFIG_ETCD_KEY are unset")
+		return nil, nil
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   strings.Split(endpoints, ","),
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		log.Fatalf("conf: configuring etcd client: %s", err)
+	}
+
+	basic = loader.NewEtcdLoader(rootCtx, client, key)
+	if coreKey := os.Getenv("SOURCEGRAPH_CONFIG_ETCD_CORE_KEY"); coreKey != "" {
+		core = loader.NewEtcdLoader(rootCtx, client, coreKey)
+	} else {
+		core = basic
+	}
+	return basic, core
 }
 
 // FormatOptions is the default format options that should be used for jsonx
@@ -0,0 +1,96 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/sourcegraph/sourcegraph/pkg/conf/loader"
+)
+
+// ConfigChange describes a single accepted configuration update: the
+// JSON-pointer paths that changed (each with its old and new value) and the
+// monotonically increasing revision the update was assigned. It is the
+// payload WatchChanges subscribers receive, in place of the plain "something
+// changed, go call Get() again" signal Watch gives.
+type ConfigChange struct {
+	Revision int
+	Changes  []ConfigFieldChange
+}
+
+// ConfigFieldChange is one field-level difference within a ConfigChange.
+// OldValue is nil when the field was added; NewValue is nil when it was
+// removed.
+type ConfigFieldChange struct {
+	Path     string
+	OldValue interface{}
+	NewValue interface{}
+}
+
+// diffRawConfig computes the field-level differences between oldRaw and
+// newRaw, two raw JSONC object documents (comments are stripped before
+// parsing), as a flat list of JSON-pointer changes. oldRaw may be ""
+// (nothing was previously loaded), in which case every field in newRaw is
+// reported as added.
+func diffRawConfig(oldRaw, newRaw string) ([]ConfigFieldChange, error) {
+	var oldDoc, newDoc map[string]interface{}
+	if oldRaw != "" {
+		if err := json.Unmarshal([]byte(loader.StripComments(oldRaw)), &oldDoc); err != nil {
+			return nil, fmt.Errorf("parsing previous configuration: %w", err)
+		}
+	}
+	if err := json.Unmarshal([]byte(loader.StripComments(newRaw)), &newDoc); err != nil {
+		return nil, fmt.Errorf("parsing new configuration: %w", err)
+	}
+
+	var changes []ConfigFieldChange
+	diffObjects("", oldDoc, newDoc, &changes)
+	return changes, nil
+}
+
+// diffObjects recursively compares old and new, appending a ConfigFieldChange
+// for every leaf (or whole-subtree, if one side isn't an object) difference
+// found under prefix.
+func diffObjects(prefix string, old, new map[string]interface{}, changes *[]ConfigFieldChange) {
+	seen := make(map[string]bool, len(old)+len(new))
+	for k := range old {
+		seen[k] = true
+	}
+	for k := range new {
+		seen[k] = true
+	}
+
+	for k := range seen {
+		path := prefix + "/" + k
+		oldV, oldOK := old[k]
+		newV, newOK := new[k]
+
+		switch {
+		case oldOK && newOK:
+			oldObj, oldIsObj := oldV.(map[string]interface{})
+			newObj, newIsObj := newV.(map[string]interface{})
+			if oldIsObj && newIsObj {
+				diffObjects(path, oldObj, newObj, changes)
+				continue
+			}
+			if !jsonEqual(oldV, newV) {
+				*changes = append(*changes, ConfigFieldChange{Path: path, OldValue: oldV, NewValue: newV})
+			}
+		case oldOK && !newOK:
+			*changes = append(*changes, ConfigFieldChange{Path: path, OldValue: oldV, NewValue: nil})
+		case !oldOK && newOK:
+			*changes = append(*changes, ConfigFieldChange{Path: path, OldValue: nil, NewValue: newV})
+		}
+	}
+}
+
+// jsonEqual reports whether a and b serialize identically, which is
+// sufficient for detecting changes between values decoded from JSON
+// (numbers, strings, bools, slices, and nested objects).
+func jsonEqual(a, b interface{}) bool {
+	aj, aerr := json.Marshal(a)
+	bj, berr := json.Marshal(b)
+	if aerr != nil || berr != nil {
+		return false
+	}
+	return string(aj) == string(bj)
+}
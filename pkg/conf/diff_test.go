@@ -0,0 +1,77 @@
+package conf
+
+import (
+	"sort"
+	"testing"
+)
+
+func changePaths(changes []ConfigFieldChange) []string {
+	paths := make([]string, len(changes))
+	for i, c := range changes {
+		paths[i] = c.Path
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestDiffRawConfigAdditionRemovalChange(t *testing.T) {
+	oldRaw := `{"a": 1, "b": {"c": 2, "d": 3}}`
+	newRaw := `{"a": 1, "b": {"c": 20}, "e": 4}`
+
+	changes, err := diffRawConfig(oldRaw, newRaw)
+	if err != nil {
+		t.Fatalf("diffRawConfig: %s", err)
+	}
+
+	got := map[string]ConfigFieldChange{}
+	for _, c := range changes {
+		got[c.Path] = c
+	}
+	want := []string{"/b/c", "/b/d", "/e"}
+	if gotPaths := changePaths(changes); !equalStrings(gotPaths, want) {
+		t.Fatalf("changed paths = %v, want %v", gotPaths, want)
+	}
+
+	if c := got["/b/c"]; c.OldValue != float64(2) || c.NewValue != float64(20) {
+		t.Errorf("/b/c = %+v, want old=2 new=20", c)
+	}
+	if c := got["/b/d"]; c.OldValue != float64(3) || c.NewValue != nil {
+		t.Errorf("/b/d = %+v, want old=3 new=nil (removed)", c)
+	}
+	if c := got["/e"]; c.OldValue != nil || c.NewValue != float64(4) {
+		t.Errorf("/e = %+v, want old=nil new=4 (added)", c)
+	}
+}
+
+func TestDiffRawConfigNoChange(t *testing.T) {
+	raw := `{"a": 1, "b": {"c": [1, 2, 3]}}`
+	changes, err := diffRawConfig(raw, raw)
+	if err != nil {
+		t.Fatalf("diffRawConfig: %s", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("changes = %+v, want none for identical documents", changes)
+	}
+}
+
+func TestDiffRawConfigEmptyOld(t *testing.T) {
+	changes, err := diffRawConfig("", `{"a": 1}`)
+	if err != nil {
+		t.Fatalf("diffRawConfig: %s", err)
+	}
+	if len(changes) != 1 || changes[0].Path != "/a" || changes[0].OldValue != nil {
+		t.Errorf("changes = %+v, want a single /a addition", changes)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,58 @@
+package loader
+
+import (
+	"os"
+	"strings"
+)
+
+// EnvPrefix is the prefix used to recognize environment variables as
+// configuration overrides, e.g. SOURCEGRAPH_CONF_AUTH_PROVIDERS.
+const EnvPrefix = "SOURCEGRAPH_CONF_"
+
+// EnvLoader maps environment variables with the SOURCEGRAPH_CONF_ prefix onto
+// JSON paths in the configuration document. The remainder of the variable
+// name, lowercased and split on "_", becomes a dotted path, e.g.
+// SOURCEGRAPH_CONF_EMAIL_SMTP_PASSWORD -> {"email": {"smtp": {"password": ...}}}.
+type EnvLoader struct {
+	environ func() []string
+}
+
+// NewEnvLoader returns a Loader that reads from the process environment.
+func NewEnvLoader() *EnvLoader {
+	return &EnvLoader{environ: os.Environ}
+}
+
+// Name implements Loader.
+func (e *EnvLoader) Name() string { return "env" }
+
+// Load implements Loader.
+func (e *EnvLoader) Load() (string, error) {
+	doc := map[string]interface{}{}
+	for _, kv := range e.environ() {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[0], EnvPrefix) {
+			continue
+		}
+		path := strings.Split(strings.ToLower(strings.TrimPrefix(parts[0], EnvPrefix)), "_")
+		setPath(doc, path, parts[1])
+	}
+	return marshalOrEmpty(doc)
+}
+
+// setPath assigns value at the nested location described by path, creating
+// intermediate objects as needed.
+func setPath(doc map[string]interface{}, path []string, value interface{}) {
+	cur := doc
+	for i, key := range path {
+		if i == len(path)-1 {
+			cur[key] = value
+			return
+		}
+		next, ok := cur[key].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			cur[key] = next
+		}
+		cur = next
+	}
+}
@@ -0,0 +1,69 @@
+package loader
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	clientv3 "go.etcd.io/etcd/clientv3"
+)
+
+// EtcdLoader reads the configuration document stored at a single etcd key and
+// pushes updates as soon as etcd's watch stream reports a change, rather than
+// waiting to be polled.
+type EtcdLoader struct {
+	client   *clientv3.Client
+	key      string
+	notify   chan struct{}
+	watchCtx context.Context
+}
+
+// NewEtcdLoader returns a Loader backed by the given etcd client and key,
+// watching for changes until ctx is done. Callers should pass a context tied
+// to their own shutdown signal (e.g. conf's rootCtx, cancelled by conf.Stop)
+// rather than context.Background(), or the watch goroutine leaks for the
+// lifetime of the process.
+func NewEtcdLoader(ctx context.Context, client *clientv3.Client, key string) *EtcdLoader {
+	e := &EtcdLoader{
+		client:   client,
+		key:      key,
+		notify:   make(chan struct{}, 1),
+		watchCtx: ctx,
+	}
+	go e.watch()
+	return e
+}
+
+func (e *EtcdLoader) watch() {
+	// Cancelling watchCtx makes etcd's client close this channel on its own,
+	// ending the loop below -- see clientv3.Client.Watch.
+	watchChan := e.client.Watch(e.watchCtx, e.key)
+	for range watchChan {
+		select {
+		case e.notify <- struct{}{}:
+		default:
+		}
+	}
+	close(e.notify)
+}
+
+// Name implements Loader.
+func (e *EtcdLoader) Name() string { return "etcd:" + e.key }
+
+// Load implements Loader.
+func (e *EtcdLoader) Load() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := e.client.Get(ctx, e.key)
+	if err != nil {
+		return "", errors.Wrapf(err, "getting etcd key %s", e.key)
+	}
+	if len(resp.Kvs) == 0 {
+		return "", nil
+	}
+	return string(resp.Kvs[0].Value), nil
+}
+
+// Notify implements Watcher.
+func (e *EtcdLoader) Notify() <-chan struct{} { return e.notify }
@@ -0,0 +1,82 @@
+package loader
+
+import (
+	"io/ioutil"
+	"log"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+)
+
+// FileLoader reads raw configuration JSON from a file on disk and hot-reloads
+// it via fsnotify, so operators don't need to restart the service after
+// editing the file.
+type FileLoader struct {
+	path    string
+	watcher *fsnotify.Watcher
+	notify  chan struct{}
+}
+
+// NewFileLoader returns a Loader backed by the file at path. The file is
+// watched for writes/renames (editors commonly replace files atomically) for
+// as long as the returned loader is used.
+func NewFileLoader(path string) (*FileLoader, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, errors.Wrap(err, "creating fsnotify watcher")
+	}
+	if err := watcher.Add(path); err != nil {
+		watcher.Close()
+		return nil, errors.Wrapf(err, "watching %s", path)
+	}
+
+	f := &FileLoader{
+		path:    path,
+		watcher: watcher,
+		notify:  make(chan struct{}, 1),
+	}
+	go f.watch()
+	return f, nil
+}
+
+func (f *FileLoader) watch() {
+	for {
+		select {
+		case event, ok := <-f.watcher.Events:
+			if !ok {
+				close(f.notify)
+				return
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) != 0 {
+				select {
+				case f.notify <- struct{}{}:
+				default:
+				}
+			}
+		case err, ok := <-f.watcher.Errors:
+			if !ok {
+				close(f.notify)
+				return
+			}
+			log.Printf("conf: error watching %s: %s", f.path, err)
+		}
+	}
+}
+
+// Name implements Loader.
+func (f *FileLoader) Name() string { return "file:" + f.path }
+
+// Load implements Loader.
+func (f *FileLoader) Load() (string, error) {
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return "", errors.Wrapf(err, "reading %s", f.path)
+	}
+	return string(data), nil
+}
+
+// Notify implements Watcher.
+func (f *FileLoader) Notify() <-chan struct{} { return f.notify }
+
+// Close stops watching the file.
+func (f *FileLoader) Close() error { return f.watcher.Close() }
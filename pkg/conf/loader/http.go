@@ -0,0 +1,83 @@
+package loader
+
+import (
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// HTTPLoader polls a remote HTTP endpoint for configuration JSON, using the
+// ETag/If-None-Match headers to avoid re-downloading and re-merging unchanged
+// documents.
+type HTTPLoader struct {
+	url          string
+	pollInterval time.Duration
+	client       *http.Client
+
+	mu       sync.Mutex
+	etag     string
+	lastBody string
+}
+
+// NewHTTPLoader returns a Loader that fetches url on each call to Load. It
+// does not poll on its own; pollInterval is only reported back by
+// PollInterval.
+func NewHTTPLoader(url string, pollInterval time.Duration) *HTTPLoader {
+	return &HTTPLoader{
+		url:          url,
+		pollInterval: pollInterval,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Name implements Loader.
+func (h *HTTPLoader) Name() string { return "http:" + h.url }
+
+// Load implements Loader. A 304 response (unchanged since the last poll)
+// returns the previously cached body rather than re-fetching.
+func (h *HTTPLoader) Load() (string, error) {
+	req, err := http.NewRequest("GET", h.url, nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "building request for %s", h.url)
+	}
+
+	h.mu.Lock()
+	etag := h.etag
+	h.mu.Unlock()
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return "", errors.Wrapf(err, "fetching %s", h.url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		return h.lastBody, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("fetching %s: unexpected status %d", h.url, resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", errors.Wrapf(err, "reading response body from %s", h.url)
+	}
+
+	h.mu.Lock()
+	h.etag = resp.Header.Get("ETag")
+	h.lastBody = string(body)
+	h.mu.Unlock()
+
+	return string(body), nil
+}
+
+// PollInterval returns the interval callers should use to re-invoke Load.
+func (h *HTTPLoader) PollInterval() time.Duration { return h.pollInterval }
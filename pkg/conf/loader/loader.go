@@ -0,0 +1,209 @@
+// Package loader provides pluggable sources for raw site configuration JSON
+// (file, environment variables, HTTP, etcd, Vault) and a way to compose them
+// into a single deterministic document.
+package loader
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Loader fetches a raw (possibly partial) configuration document. Implementations
+// may additionally implement Watcher if they can push updates rather than
+// waiting to be polled.
+type Loader interface {
+	// Name identifies the loader in logs and the SOURCEGRAPH_CONFIG_LOADERS chain.
+	Name() string
+
+	// Load returns the loader's current view of the configuration as a JSON
+	// object (or "" if the loader has nothing to contribute).
+	Load() (rawJSON string, err error)
+}
+
+// Watcher is implemented by Loaders that can notify of changes without being
+// polled (e.g. etcd watches, fsnotify). LoaderChain.Notify fans these in, so
+// the chain's caller can reload it as soon as any single loader changes.
+type Watcher interface {
+	// Notify returns a channel that receives a value whenever the loader's
+	// underlying source has changed. The channel is closed when the loader
+	// is stopped.
+	Notify() <-chan struct{}
+}
+
+// LoaderChain merges the raw JSON documents produced by an ordered list of
+// Loaders into a single document. Later loaders override earlier ones;
+// objects are merged key-by-key (deep), arrays are replaced wholesale.
+type LoaderChain struct {
+	loaders []Loader
+}
+
+// NewLoaderChain constructs a LoaderChain that applies loaders in the given
+// order, i.e. loaders[len(loaders)-1] has the highest priority.
+func NewLoaderChain(loaders ...Loader) *LoaderChain {
+	return &LoaderChain{loaders: loaders}
+}
+
+// Load runs every loader in order and merges their output. It is the
+// LoaderChain's implementation of the same contract as a single Loader, so it
+// can be plugged directly into conf's basicFetcher/coreFetcher.
+func (c *LoaderChain) Load() (string, error) {
+	var merged map[string]interface{}
+	for _, l := range c.loaders {
+		rawJSON, err := l.Load()
+		if err != nil {
+			return "", errors.Wrapf(err, "loader %q", l.Name())
+		}
+		if strings.TrimSpace(rawJSON) == "" {
+			continue
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal([]byte(StripComments(rawJSON)), &doc); err != nil {
+			return "", errors.Wrapf(err, "loader %q produced invalid JSON", l.Name())
+		}
+		merged = mergeObjects(merged, doc)
+	}
+	if merged == nil {
+		return "{}", nil
+	}
+	out, err := json.Marshal(merged)
+	if err != nil {
+		return "", errors.Wrap(err, "marshaling merged configuration")
+	}
+	return string(out), nil
+}
+
+// Loaders returns the ordered list of loaders in the chain, for callers that
+// need to know which sources contribute to the merged document.
+func (c *LoaderChain) Loaders() []Loader {
+	return c.loaders
+}
+
+// Notify implements Watcher by fanning in the Notify channels of every
+// constituent loader that implements it, so a caller driven by a fixed poll
+// interval (e.g. conf's continuouslyUpdate) can instead react as soon as any
+// one of them pushes a change. If no loader in the chain implements Watcher,
+// the returned channel is simply never sent to or closed.
+func (c *LoaderChain) Notify() <-chan struct{} {
+	merged := make(chan struct{}, 1)
+
+	var watchers []Watcher
+	for _, l := range c.loaders {
+		if w, ok := l.(Watcher); ok {
+			watchers = append(watchers, w)
+		}
+	}
+	if len(watchers) == 0 {
+		return merged
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(watchers))
+	for _, w := range watchers {
+		go func(w Watcher) {
+			defer wg.Done()
+			for range w.Notify() {
+				select {
+				case merged <- struct{}{}:
+				default:
+				}
+			}
+		}(w)
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+
+	return merged
+}
+
+// marshalOrEmpty marshals doc to JSON, or returns "" (no contribution) if doc
+// is empty. Loaders use this so an absent source doesn't clobber others with
+// an empty object during merge.
+func marshalOrEmpty(doc map[string]interface{}) (string, error) {
+	if len(doc) == 0 {
+		return "", nil
+	}
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return "", errors.Wrap(err, "marshaling configuration")
+	}
+	return string(out), nil
+}
+
+// StripComments removes "//" line comments and "/* */" block comments from
+// raw, a JSONC document, so it can be parsed with encoding/json. It is
+// string-literal aware: a "//" or "/*" inside a JSON string is left alone.
+// Sourcegraph site configuration files are JSONC (see conf.FormatOptions),
+// so every loader that reads raw file content must pass it through this
+// before unmarshaling.
+func StripComments(raw string) string {
+	var out strings.Builder
+	runes := []rune(raw)
+	inString := false
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		if inString {
+			out.WriteRune(r)
+			switch r {
+			case '\\':
+				if i+1 < len(runes) {
+					i++
+					out.WriteRune(runes[i])
+				}
+			case '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case r == '"':
+			inString = true
+			out.WriteRune(r)
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			i--
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			i += 2
+			for i+1 < len(runes) && !(runes[i] == '*' && runes[i+1] == '/') {
+				i++
+			}
+			i++
+		default:
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
+// mergeObjects deep-merges override on top of base. Arrays in override fully
+// replace arrays in base (they are never concatenated), matching the
+// semantics operators expect from e.g. Helm values files.
+func mergeObjects(base, override map[string]interface{}) map[string]interface{} {
+	if base == nil {
+		return override
+	}
+	merged := make(map[string]interface{}, len(base))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		if existing, ok := merged[k]; ok {
+			if existingObj, ok := existing.(map[string]interface{}); ok {
+				if overrideObj, ok := v.(map[string]interface{}); ok {
+					merged[k] = mergeObjects(existingObj, overrideObj)
+					continue
+				}
+			}
+		}
+		merged[k] = v
+	}
+	return merged
+}
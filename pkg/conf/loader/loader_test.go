@@ -0,0 +1,44 @@
+package loader
+
+import "testing"
+
+func TestStripComments(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "line comment",
+			in:   "{\n  // a comment\n  \"a\": 1\n}",
+			want: "{\n  \n  \"a\": 1\n}",
+		},
+		{
+			name: "block comment",
+			in:   `{"a": /* inline */ 1}`,
+			want: `{"a":  1}`,
+		},
+		{
+			name: "slashes inside a string are left alone",
+			in:   `{"url": "http://example.com"}`,
+			want: `{"url": "http://example.com"}`,
+		},
+		{
+			name: "comment marker inside a string is left alone",
+			in:   `{"a": "// not a comment"}`,
+			want: `{"a": "// not a comment"}`,
+		},
+		{
+			name: "escaped quote inside a string doesn't end it early",
+			in:   `{"a": "she said \"// hi\""} // trailing`,
+			want: `{"a": "she said \"// hi\""} `,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripComments(tt.in); got != tt.want {
+				t.Errorf("StripComments(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
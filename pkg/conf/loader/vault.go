@@ -0,0 +1,176 @@
+package loader
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"github.com/pkg/errors"
+)
+
+// SecretPaths lists the JSON-pointer paths within the merged configuration
+// document that Redact overwrites in RawBasic/RawCore responses served to
+// clients. Paths use "*" as a wildcard array index. The list is fixed: a
+// VaultLoader mapping that writes a secret to any other path is not
+// redacted.
+var SecretPaths = []string{
+	"/auth/providers/*/clientSecret",
+	"/email/smtp/password",
+	"/externalService/token",
+}
+
+// VaultLoader reads one or more secrets from HashiCorp Vault and splices them
+// into the configuration document at the JSON path each secret is mapped to.
+// Leases are renewed in the background for as long as the loader is used.
+type VaultLoader struct {
+	client *vaultapi.Client
+	// mapping maps a Vault secret path to the JSON path it should be written
+	// to in the merged document, e.g. "secret/smtp" -> []string{"email", "smtp", "password"}.
+	mapping map[string][]string
+}
+
+// NewVaultLoader returns a Loader that reads secrets from client according to
+// mapping and keeps their leases renewed until ctx is done. Callers should
+// pass a context tied to their own shutdown signal (e.g. conf's rootCtx,
+// cancelled by conf.Stop) rather than context.Background(), or the renewal
+// goroutine leaks for the lifetime of the process.
+func NewVaultLoader(ctx context.Context, client *vaultapi.Client, mapping map[string][]string) *VaultLoader {
+	v := &VaultLoader{client: client, mapping: mapping}
+	go v.renewLeases(ctx)
+	return v
+}
+
+// Name implements Loader.
+func (v *VaultLoader) Name() string { return "vault" }
+
+// Load implements Loader.
+func (v *VaultLoader) Load() (string, error) {
+	doc := map[string]interface{}{}
+	for secretPath, jsonPath := range v.mapping {
+		secret, err := v.client.Logical().Read(secretPath)
+		if err != nil {
+			return "", errors.Wrapf(err, "reading vault secret %s", secretPath)
+		}
+		if secret == nil || secret.Data == nil {
+			continue
+		}
+		value, ok := secret.Data["value"]
+		if !ok {
+			continue
+		}
+		setPath(doc, jsonPath, value)
+	}
+	return marshalOrEmpty(doc)
+}
+
+// renewLeases periodically renews the leases of secrets read via Load,
+// keeping dynamic credentials (e.g. database passwords) from expiring out
+// from under the running config.
+func (v *VaultLoader) renewLeases(ctx context.Context) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for secretPath := range v.mapping {
+				secret, err := v.client.Logical().Read(secretPath)
+				if err != nil || secret == nil || secret.LeaseID == "" {
+					continue
+				}
+				if _, err := v.client.Sys().Renew(secret.LeaseID, 0); err != nil {
+					log.Printf("conf: failed to renew vault lease for %s: %s", secretPath, err)
+				}
+			}
+		}
+	}
+}
+
+// Redact parses rawJSON and replaces every value found at a SecretPaths
+// entry with the string "REDACTED", returning the re-marshaled result. It is
+// passed to confserver.NewServer (see conf.go's init) so that every path
+// listed in SecretPaths is stripped from RawBasic/RawCore before confserver
+// serves them to other services. Only SecretPaths is consulted: a
+// Vault-loaded value at a path not in that list is served unredacted.
+func Redact(rawJSON string) (string, error) {
+	if rawJSON == "" {
+		return rawJSON, nil
+	}
+	var doc interface{}
+	if err := json.Unmarshal([]byte(rawJSON), &doc); err != nil {
+		return "", errors.Wrap(err, "parsing configuration for redaction")
+	}
+	for _, path := range SecretPaths {
+		redactPath(doc, splitPointer(path))
+	}
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return "", errors.Wrap(err, "marshaling redacted configuration")
+	}
+	return string(out), nil
+}
+
+// splitPointer splits a SecretPaths entry like "/auth/providers/*/clientSecret"
+// into its path segments, dropping the leading empty segment before the
+// first "/".
+func splitPointer(path string) []string {
+	var segments []string
+	for _, s := range splitOnSlash(path) {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+func splitOnSlash(path string) []string {
+	var out []string
+	start := 0
+	for i, r := range path {
+		if r == '/' {
+			out = append(out, path[start:i])
+			start = i + 1
+		}
+	}
+	out = append(out, path[start:])
+	return out
+}
+
+// redactPath walks doc according to segments (a "*" segment means "every
+// element of this array"), overwriting whatever value it finds at the end of
+// the path with "REDACTED". Missing paths are silently ignored: not every
+// document has every secret field set.
+func redactPath(doc interface{}, segments []string) {
+	if len(segments) == 0 {
+		return
+	}
+	seg := segments[0]
+	rest := segments[1:]
+
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		child, ok := v[seg]
+		if !ok {
+			return
+		}
+		if len(rest) == 0 {
+			v[seg] = "REDACTED"
+			return
+		}
+		redactPath(child, rest)
+	case []interface{}:
+		if seg != "*" {
+			return
+		}
+		for i, child := range v {
+			if len(rest) == 0 {
+				v[i] = "REDACTED"
+				continue
+			}
+			redactPath(child, rest)
+		}
+	}
+}
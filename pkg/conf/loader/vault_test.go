@@ -0,0 +1,69 @@
+package loader
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	in := `{
+		"auth": {"providers": [{"clientSecret": "s1"}, {"clientSecret": "s2"}]},
+		"email": {"smtp": {"password": "hunter2", "host": "smtp.example.com"}},
+		"externalService": {"token": "tok", "url": "https://example.com"}
+	}`
+
+	out, err := Redact(in)
+	if err != nil {
+		t.Fatalf("Redact: %s", err)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("Redact produced invalid JSON: %s", err)
+	}
+
+	providers := doc["auth"].(map[string]interface{})["providers"].([]interface{})
+	for i, p := range providers {
+		secret := p.(map[string]interface{})["clientSecret"]
+		if secret != "REDACTED" {
+			t.Errorf("providers[%d].clientSecret = %v, want REDACTED", i, secret)
+		}
+	}
+
+	smtp := doc["email"].(map[string]interface{})["smtp"].(map[string]interface{})
+	if smtp["password"] != "REDACTED" {
+		t.Errorf("email.smtp.password = %v, want REDACTED", smtp["password"])
+	}
+	if smtp["host"] != "smtp.example.com" {
+		t.Errorf("email.smtp.host = %v, want unchanged", smtp["host"])
+	}
+
+	ext := doc["externalService"].(map[string]interface{})
+	if ext["token"] != "REDACTED" {
+		t.Errorf("externalService.token = %v, want REDACTED", ext["token"])
+	}
+	if ext["url"] != "https://example.com" {
+		t.Errorf("externalService.url = %v, want unchanged", ext["url"])
+	}
+}
+
+func TestRedactMissingPathsAreNoop(t *testing.T) {
+	in := `{"externalURL": "https://example.com"}`
+	out, err := Redact(in)
+	if err != nil {
+		t.Fatalf("Redact: %s", err)
+	}
+	if out != `{"externalURL":"https://example.com"}` {
+		t.Errorf("Redact(%q) = %q, want doc unchanged (modulo re-marshaling)", in, out)
+	}
+}
+
+func TestRedactEmpty(t *testing.T) {
+	out, err := Redact("")
+	if err != nil {
+		t.Fatalf("Redact: %s", err)
+	}
+	if out != "" {
+		t.Errorf("Redact(\"\") = %q, want \"\"", out)
+	}
+}
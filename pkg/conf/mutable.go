@@ -0,0 +1,29 @@
+//go:build conf_allow_mutable
+
+package conf
+
+// GetMutable returns a copy of the configuration as the underlying mutable
+// struct, bypassing the ReadOnlyBasic/ReadOnlyCore interfaces that Get
+// returns. The returned value should still NEVER be modified in place (it
+// aliases the cached config's fields, e.g. slices); this only exists for
+// call sites that need the concrete *schema.*SiteConfiguration type itself,
+// e.g. to re-marshal it.
+//
+// GetMutable only compiles with `-tags conf_allow_mutable`, which is not set
+// for ordinary service builds. New code should use Get; if you're adding a
+// new conf_allow_mutable build target, it almost certainly means Get's
+// interfaces are missing a getter you need, not that you need the struct.
+//
+// GetMutable is a wrapper around client.GetMutable.
+func GetMutable() *SiteConfiguration {
+	return defaultClient.GetMutable()
+}
+
+// GetMutable returns a copy of the configuration as the underlying mutable
+// struct. See the package-level GetMutable documentation for details.
+func (c *client) GetMutable() *SiteConfiguration {
+	return &SiteConfiguration{
+		Basic: c.basicStore.LastValid(),
+		Core:  c.coreStore.LastValid(),
+	}
+}
@@ -0,0 +1,106 @@
+package conf
+
+import (
+	"encoding/json"
+
+	"github.com/sourcegraph/sourcegraph/schema"
+)
+
+// ReadOnlyBasic exposes read-only access to a schema.BasicSiteConfiguration.
+// Go's type system can't express "pointer, but read-only", so instead of
+// handing callers the struct returned by conf.Get (which they could mutate,
+// corrupting the shared cached configuration for every other reader) we hand
+// them an interface of getters over an unexported wrapper.
+//
+// The named getters here mirror schema.BasicSiteConfiguration's
+// most-frequently-used fields; run `dev/conf-readonly-codemod` to keep
+// existing `conf.Get().Basic.Foo` call sites compiling against the new
+// accessor methods as fields are added. Field is the fallback for
+// everything else: it covers the full struct by its JSON tags, so a caller
+// is never left with no way to reach a value (short of conf.GetMutable,
+// which only builds with the conf_allow_mutable tag and is not for routine
+// reads).
+type ReadOnlyBasic interface {
+	AuthProviders() []schema.AuthProviders
+	ExternalURL() string
+	LicenseKey() string
+	UpdateChannel() string
+
+	// Field looks up jsonName (the field's `json:"..."` tag, e.g.
+	// "auth.providers") against the underlying
+	// schema.BasicSiteConfiguration, and returns its value as raw JSON. It
+	// returns ok=false if no field has that tag.
+	Field(jsonName string) (value json.RawMessage, ok bool)
+}
+
+type readOnlyBasic struct {
+	basic *schema.BasicSiteConfiguration
+}
+
+// AuthProviders returns a copy of the configured auth providers slice, not
+// the cached config's backing array -- otherwise callers mutating the
+// returned slice (e.g. `conf.Get().Basic.AuthProviders()[0].ClientSecret =
+// ...`) would corrupt the shared cached config for every other reader,
+// defeating the whole point of this being a read-only view.
+func (r readOnlyBasic) AuthProviders() []schema.AuthProviders {
+	providers := make([]schema.AuthProviders, len(r.basic.AuthProviders))
+	copy(providers, r.basic.AuthProviders)
+	return providers
+}
+func (r readOnlyBasic) ExternalURL() string   { return r.basic.ExternalURL }
+func (r readOnlyBasic) LicenseKey() string    { return r.basic.LicenseKey }
+func (r readOnlyBasic) UpdateChannel() string { return r.basic.UpdateChannel }
+
+func (r readOnlyBasic) Field(jsonName string) (json.RawMessage, bool) {
+	return fieldByJSONTag(r.basic, jsonName)
+}
+
+// ReadOnlyCore exposes read-only access to a schema.CoreSiteConfiguration.
+// See ReadOnlyBasic for why this exists instead of returning the struct, and
+// for the Field fallback's contract.
+type ReadOnlyCore interface {
+	ExternalURL() string
+	UpdateChannel() string
+
+	Field(jsonName string) (value json.RawMessage, ok bool)
+}
+
+type readOnlyCore struct {
+	core *schema.CoreSiteConfiguration
+}
+
+func (r readOnlyCore) ExternalURL() string   { return r.core.ExternalURL }
+func (r readOnlyCore) UpdateChannel() string { return r.core.UpdateChannel }
+
+func (r readOnlyCore) Field(jsonName string) (json.RawMessage, bool) {
+	return fieldByJSONTag(r.core, jsonName)
+}
+
+// fieldByJSONTag marshals structPtr (a pointer to a schema struct) to JSON
+// and returns the raw value of the top-level field whose `json:"..."` tag
+// matches jsonName. Marshaling the whole struct and re-parsing, rather than
+// reflecting over struct tags directly, keeps this correct for fields with
+// custom MarshalJSON methods or omitempty behavior without duplicating
+// encoding/json's own tag-parsing rules.
+func fieldByJSONTag(structPtr interface{}, jsonName string) (json.RawMessage, bool) {
+	raw, err := json.Marshal(structPtr)
+	if err != nil {
+		return nil, false
+	}
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, false
+	}
+	value, ok := doc[jsonName]
+	return value, ok
+}
+
+// ReadOnlySiteConfiguration is what conf.Get() returns by default: a
+// read-only view over the process's cached site configuration. Callers that
+// legitimately need the underlying struct (e.g. to deep-copy it into a
+// response body) should use conf.GetMutable instead of working around this
+// with reflection or unsafe.
+type ReadOnlySiteConfiguration struct {
+	Basic ReadOnlyBasic
+	Core  ReadOnlyCore
+}
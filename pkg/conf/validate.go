@@ -0,0 +1,47 @@
+package conf
+
+import (
+	"sync"
+
+	multierror "github.com/hashicorp/go-multierror"
+)
+
+// Validator checks a candidate configuration for problems that should block
+// it from being applied at all, e.g. "SMTP settings parse" or "auth.providers
+// reference existing OIDC discovery docs". Validators run before any
+// subsystem is given a chance to observe the candidate; compare with
+// StagedWatcher, which runs after.
+type Validator func(candidate *SiteConfiguration) error
+
+var (
+	validatorsMu sync.Mutex
+	validators   []Validator
+)
+
+// RegisterValidator adds v to the set of Validators run against every
+// candidate configuration submitted via ApplyCandidate. Validators are
+// typically registered from an init function in the package that owns the
+// setting being validated.
+func RegisterValidator(v Validator) {
+	validatorsMu.Lock()
+	defer validatorsMu.Unlock()
+	validators = append(validators, v)
+}
+
+// runValidators runs every registered Validator against candidate, combining
+// all of their errors so a submitter sees every problem at once rather than
+// fixing them one at a time.
+func runValidators(candidate *SiteConfiguration) error {
+	validatorsMu.Lock()
+	vs := make([]Validator, len(validators))
+	copy(vs, validators)
+	validatorsMu.Unlock()
+
+	var errs *multierror.Error
+	for _, v := range vs {
+		if err := v(candidate); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return errs.ErrorOrNil()
+}